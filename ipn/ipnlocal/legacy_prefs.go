@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"os"
+
+	"tailscale.com/ipn"
+)
+
+// LegacyPrefsSource knows how to locate and load the prefs of a single
+// pre-profiles Tailscale install for a given local user, so that
+// profileManager can migrate it into the profiles store exactly once.
+//
+// uid is an opaque, platform-specific user identifier: a Windows SID string
+// on Windows, or a stringified Unix UID elsewhere.
+type LegacyPrefsSource interface {
+	// Locate returns the path to the legacy prefs file for uid, and
+	// whether this platform/user has one that still needs migrating. It
+	// returns ok == false both when uid never had a legacy install and
+	// when that install has already been migrated.
+	Locate(uid string) (path string, ok bool)
+
+	// Load reads and upgrades the legacy prefs found at path, a value
+	// previously returned by Locate.
+	Load(path string) (*ipn.Prefs, error)
+
+	// MarkMigrated records that path has been migrated, so that a later
+	// Locate call for the same user reports ok == false.
+	MarkMigrated(path string) error
+}
+
+// errNoLegacyPrefs is returned by loadLegacyPrefs when no registered source
+// has anything left to migrate for the current user.
+var errNoLegacyPrefs = errors.New("no legacy prefs to migrate")
+
+// migratedSuffix marks a legacy prefs file, of whatever platform-specific
+// name, as already migrated into the profiles store. Sources that don't
+// have a more natural migrated-marker of their own (a Windows-style
+// sentinel file in the same directory, for example) can simply touch
+// path+migratedSuffix.
+const migratedSuffix = ".migrated"
+
+// legacyPrefsSources lists, in registration order, every LegacyPrefsSource
+// this build knows about. It's a slice, rather than a single platform-picked
+// value, so that a machine that has been upgraded through several old
+// layouts can still be migrated from whichever one actually has prefs on
+// disk; each platform's init() registers only the source(s) relevant to it.
+var legacyPrefsSources []LegacyPrefsSource
+
+func registerLegacyPrefsSource(s LegacyPrefsSource) {
+	legacyPrefsSources = append(legacyPrefsSources, s)
+}
+
+// loadLegacyPrefs consults every registered LegacyPrefsSource in turn for
+// uid's legacy prefs, returning the first one found. The returned complete
+// func must be called once the resulting profile has been saved, so that
+// this user isn't migrated again.
+func (pm *profileManager) loadLegacyPrefs() (complete func() error, prefs ipn.PrefsView, err error) {
+	uid := string(pm.currentUserID)
+	for _, src := range legacyPrefsSources {
+		path, ok := src.Locate(uid)
+		if !ok {
+			continue
+		}
+		p, err := src.Load(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, ipn.PrefsView{}, err
+		}
+		pm.logf("migrating legacy profile (%T) to new format", src)
+		return func() error { return src.MarkMigrated(path) }, p.View(), nil
+	}
+	return nil, ipn.PrefsView{}, errNoLegacyPrefs
+}
+
+// completeMigration invokes complete, the func previously returned by
+// loadLegacyPrefs, once the migrated profile has been durably saved.
+func (pm *profileManager) completeMigration(complete func() error) {
+	if complete == nil {
+		return
+	}
+	if err := complete(); err != nil {
+		pm.logf("marking legacy prefs as migrated: %v", err)
+	}
+}
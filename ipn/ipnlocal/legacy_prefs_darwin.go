@@ -0,0 +1,69 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"tailscale.com/ipn"
+)
+
+// darwinLegacyContainerPrefsPath is where the pre-profiles, sandboxed
+// Tailscale macOS GUI app stored its single prefs file, inside its App
+// Sandbox container, relative to the user's home directory. It's a var,
+// rather than a const, so that tests can override it; tests fake
+// darwinUserHomeDir so that it resolves under a temp directory instead of
+// a real home directory.
+var darwinLegacyContainerPrefsPath = "Library/Containers/io.tailscale.ipn.macsys/Data/Library/Application Support/Tailscale/prefs"
+
+// darwinUserHomeDir resolves uid to its home directory. It's a var so
+// tests can fake it without needing real local user accounts.
+var darwinUserHomeDir = func(uid string) (string, error) {
+	usr, err := user.LookupId(uid)
+	if err != nil {
+		return "", err
+	}
+	return usr.HomeDir, nil
+}
+
+// darwinLoadPrefs is overridden in tests so they don't depend on the
+// on-disk prefs format.
+var darwinLoadPrefs = ipn.LoadPrefs
+
+func init() {
+	registerLegacyPrefsSource(darwinLegacyPrefsSource{})
+}
+
+// darwinLegacyPrefsSource migrates the prefs file left behind by the
+// pre-profiles, sandboxed Tailscale macOS GUI app.
+type darwinLegacyPrefsSource struct{}
+
+func (darwinLegacyPrefsSource) Locate(uid string) (string, bool) {
+	homeDir, err := darwinUserHomeDir(uid)
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(homeDir, darwinLegacyContainerPrefsPath)
+	if _, err := os.Stat(path + migratedSuffix); err == nil {
+		return "", false // already migrated
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func (darwinLegacyPrefsSource) Load(path string) (*ipn.Prefs, error) {
+	return darwinLoadPrefs(path)
+}
+
+func (darwinLegacyPrefsSource) MarkMigrated(path string) error {
+	f, err := os.OpenFile(path+migratedSuffix, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+func TestDarwinLegacyPrefsSource(t *testing.T) {
+	home := t.TempDir()
+	const uid = "501"
+
+	origHomeDir, origContainerPath, origLoad := darwinUserHomeDir, darwinLegacyContainerPrefsPath, darwinLoadPrefs
+	darwinLegacyContainerPrefsPath = "Library/Containers/io.tailscale.ipn.macsys/Data/Library/Application Support/Tailscale/prefs"
+	darwinUserHomeDir = func(u string) (string, error) {
+		if u != uid {
+			return "", errors.New("no such user")
+		}
+		return home, nil
+	}
+	t.Cleanup(func() {
+		darwinUserHomeDir = origHomeDir
+		darwinLegacyContainerPrefsPath = origContainerPath
+		darwinLoadPrefs = origLoad
+	})
+
+	var src darwinLegacyPrefsSource
+	wantPath := filepath.Join(home, darwinLegacyContainerPrefsPath)
+
+	// No container prefs file on disk yet: nothing to migrate.
+	if _, ok := src.Locate(uid); ok {
+		t.Fatalf("Locate reported a legacy install before one existed")
+	}
+	// An unknown uid never has anything to migrate.
+	if _, ok := src.Locate("other-uid"); ok {
+		t.Fatalf("Locate reported a legacy install for an unknown uid")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(wantPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(wantPath, []byte("fake legacy prefs"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := &ipn.Prefs{ControlURL: "https://example.com"}
+	darwinLoadPrefs = func(p string) (*ipn.Prefs, error) {
+		if p != wantPath {
+			t.Fatalf("Load called with path %q, want %q", p, wantPath)
+		}
+		return want, nil
+	}
+
+	got, ok := src.Locate(uid)
+	if !ok || got != wantPath {
+		t.Fatalf("Locate = %q, %v; want %q, true", got, ok, wantPath)
+	}
+
+	loaded, err := src.Load(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ControlURL != want.ControlURL {
+		t.Errorf("Load: ControlURL = %q, want %q", loaded.ControlURL, want.ControlURL)
+	}
+
+	if err := src.MarkMigrated(got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := src.Locate(uid); ok {
+		t.Errorf("Locate reported a legacy install after MarkMigrated")
+	}
+}
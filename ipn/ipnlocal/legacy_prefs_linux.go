@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"os"
+
+	"tailscale.com/ipn"
+)
+
+// linuxLegacyPrefsPath is where early, pre-profiles Linux builds of
+// tailscaled kept their single set of prefs, before per-user profiles
+// existed. It's a var, rather than a const, so that tests can point it at
+// a temp directory instead of the real /var/lib/tailscale.
+var linuxLegacyPrefsPath = "/var/lib/tailscale/prefs"
+
+// linuxLoadPrefs is overridden in tests so they don't depend on the
+// on-disk prefs format.
+var linuxLoadPrefs = ipn.LoadPrefs
+
+func init() {
+	registerLegacyPrefsSource(linuxLegacyPrefsSource{})
+}
+
+// linuxLegacyPrefsSource migrates the single, machine-wide prefs file that
+// pre-profiles tailscaled wrote on Linux. There is only ever one such file,
+// regardless of uid, so it is migrated into whichever profile first asks
+// for it.
+type linuxLegacyPrefsSource struct{}
+
+func (linuxLegacyPrefsSource) Locate(uid string) (string, bool) {
+	if _, err := os.Stat(linuxLegacyPrefsPath + migratedSuffix); err == nil {
+		return "", false // already migrated
+	}
+	if _, err := os.Stat(linuxLegacyPrefsPath); err != nil {
+		return "", false
+	}
+	return linuxLegacyPrefsPath, true
+}
+
+func (linuxLegacyPrefsSource) Load(path string) (*ipn.Prefs, error) {
+	return linuxLoadPrefs(path)
+}
+
+func (linuxLegacyPrefsSource) MarkMigrated(path string) error {
+	f, err := os.OpenFile(path+migratedSuffix, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+func TestLinuxLegacyPrefsSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prefs")
+
+	origPath, origLoad := linuxLegacyPrefsPath, linuxLoadPrefs
+	linuxLegacyPrefsPath = path
+	t.Cleanup(func() {
+		linuxLegacyPrefsPath = origPath
+		linuxLoadPrefs = origLoad
+	})
+
+	var src linuxLegacyPrefsSource
+
+	// No prefs file on disk yet: nothing to migrate.
+	if _, ok := src.Locate("0"); ok {
+		t.Fatalf("Locate reported a legacy install before one existed")
+	}
+
+	if err := os.WriteFile(path, []byte("fake legacy prefs"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := &ipn.Prefs{ControlURL: "https://example.com"}
+	linuxLoadPrefs = func(p string) (*ipn.Prefs, error) {
+		if p != path {
+			t.Fatalf("Load called with path %q, want %q", p, path)
+		}
+		return want, nil
+	}
+
+	// uid is ignored: there's only ever one machine-wide legacy prefs file.
+	got, ok := src.Locate("whatever-uid")
+	if !ok || got != path {
+		t.Fatalf("Locate = %q, %v; want %q, true", got, ok, path)
+	}
+
+	loaded, err := src.Load(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ControlURL != want.ControlURL {
+		t.Errorf("Load: ControlURL = %q, want %q", loaded.ControlURL, want.ControlURL)
+	}
+
+	if err := src.MarkMigrated(got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := src.Locate("whatever-uid"); ok {
+		t.Errorf("Locate reported a legacy install after MarkMigrated")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"os"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+// fakeLegacyPrefsSource is a minimal in-memory LegacyPrefsSource for testing
+// the multi-source fallback in profileManager.loadLegacyPrefs.
+type fakeLegacyPrefsSource struct {
+	path     string // non-empty if this source has something to offer
+	prefs    *ipn.Prefs
+	migrated bool
+	loadErr  error
+}
+
+func (f *fakeLegacyPrefsSource) Locate(uid string) (string, bool) {
+	if f.path == "" || f.migrated {
+		return "", false
+	}
+	return f.path, true
+}
+
+func (f *fakeLegacyPrefsSource) Load(path string) (*ipn.Prefs, error) {
+	if f.loadErr != nil {
+		return nil, f.loadErr
+	}
+	return f.prefs, nil
+}
+
+func (f *fakeLegacyPrefsSource) MarkMigrated(path string) error {
+	f.migrated = true
+	return nil
+}
+
+func withLegacyPrefsSources(t *testing.T, sources ...LegacyPrefsSource) {
+	t.Helper()
+	prev := legacyPrefsSources
+	legacyPrefsSources = sources
+	t.Cleanup(func() { legacyPrefsSources = prev })
+}
+
+func TestLoadLegacyPrefsFallsThroughSources(t *testing.T) {
+	empty := &fakeLegacyPrefsSource{} // e.g. a platform with no legacy install
+	notFound := &fakeLegacyPrefsSource{path: "/legacy/none", loadErr: os.ErrNotExist}
+	found := &fakeLegacyPrefsSource{path: "/legacy/found", prefs: &ipn.Prefs{ControlURL: "https://example.com"}}
+	withLegacyPrefsSources(t, empty, notFound, found)
+
+	pm := &profileManager{logf: t.Logf}
+	complete, prefs, err := pm.loadLegacyPrefs()
+	if err != nil {
+		t.Fatalf("loadLegacyPrefs: %v", err)
+	}
+	if got := prefs.ControlURL(); got != "https://example.com" {
+		t.Errorf("loadLegacyPrefs: ControlURL = %q, want https://example.com", got)
+	}
+	if found.migrated {
+		t.Fatalf("source was marked migrated before complete was called")
+	}
+	pm.completeMigration(complete)
+	if !found.migrated {
+		t.Errorf("completeMigration did not mark the matched source as migrated")
+	}
+}
+
+func TestLoadLegacyPrefsNoSources(t *testing.T) {
+	withLegacyPrefsSources(t)
+	pm := &profileManager{logf: t.Logf}
+	if _, _, err := pm.loadLegacyPrefs(); err != errNoLegacyPrefs {
+		t.Errorf("loadLegacyPrefs with no sources: err = %v, want errNoLegacyPrefs", err)
+	}
+}
@@ -4,12 +4,12 @@
 package ipnlocal
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 
+	"golang.org/x/sys/windows/registry"
 	"tailscale.com/atomicfile"
 	"tailscale.com/ipn"
 	"tailscale.com/util/winutil/policy"
@@ -21,12 +21,62 @@ const (
 	legacyPrefsExt                   = ".conf"
 )
 
-var errAlreadyMigrated = errors.New("profile migration already completed")
+// The following are overridden in tests with a fake filesystem, so that
+// migration logic can be exercised without touching the real disk or
+// registry.
+var (
+	statFile      = os.Stat
+	loadPrefsFile = ipn.LoadPrefs
+	writeSentinel = func(name string) error {
+		return atomicfile.WriteFile(name, []byte{}, 0600)
+	}
+	lookupUserHomeDir = defaultLookupUserHomeDir
+)
 
-func legacyPrefsDir(uid ipn.WindowsUserID) (string, error) {
-	// TODO(aaron): Ideally we'd have the impersonation token for the pipe's
-	// client and use it to call SHGetKnownFolderPath, thus yielding the correct
-	// path without having to make gross assumptions about directory names.
+func init() {
+	registerLegacyPrefsSource(windowsLegacyPrefsSource{})
+}
+
+// windowsLegacyPrefsSource locates and loads the pre-profiles
+// AppData\Local\Tailscale\prefs.conf that every per-user tailscale.exe GUI
+// used to maintain, for migration into the profiles store.
+type windowsLegacyPrefsSource struct{}
+
+func (windowsLegacyPrefsSource) Locate(uid string) (string, bool) {
+	dir, err := legacyPrefsDir(ipn.WindowsUserID(uid))
+	if err != nil {
+		return "", false
+	}
+	sentinel := filepath.Join(dir, legacyPrefsMigrationSentinelFile+legacyPrefsExt)
+	if _, err := statFile(sentinel); err == nil {
+		return "", false // already migrated
+	}
+	path := filepath.Join(dir, legacyPrefsFile+legacyPrefsExt)
+	if _, err := statFile(path); err != nil {
+		return "", false // no legacy prefs for this user
+	}
+	return path, true
+}
+
+func (windowsLegacyPrefsSource) Load(path string) (*ipn.Prefs, error) {
+	prefs, err := loadPrefsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs.ControlURL = policy.SelectControlURL(defaultPrefs.ControlURL(), prefs.ControlURL)
+	prefs.ExitNodeIP = resolveExitNodeIP(prefs.ExitNodeIP)
+	prefs.ShieldsUp = resolveShieldsUp(prefs.ShieldsUp)
+	prefs.ForceDaemon = resolveForceDaemon(prefs.ForceDaemon)
+	return prefs, nil
+}
+
+func (windowsLegacyPrefsSource) MarkMigrated(path string) error {
+	sentinel := filepath.Join(filepath.Dir(path), legacyPrefsMigrationSentinelFile+legacyPrefsExt)
+	return writeSentinel(sentinel)
+}
+
+func defaultLookupUserHomeDir(uid ipn.WindowsUserID) (string, error) {
 	usr, err := user.LookupId(string(uid))
 	if err != nil {
 		return "", err
@@ -34,43 +84,101 @@ func legacyPrefsDir(uid ipn.WindowsUserID) (string, error) {
 	if usr.HomeDir == "" {
 		return "", fmt.Errorf("user %q does not have a home directory", uid)
 	}
-	userLegacyPrefsDir := filepath.Join(usr.HomeDir, "AppData", "Local", "Tailscale")
-	return userLegacyPrefsDir, nil
+	return usr.HomeDir, nil
 }
 
-func (pm *profileManager) loadLegacyPrefs() (string, ipn.PrefsView, error) {
-	userLegacyPrefsDir, err := legacyPrefsDir(pm.currentUserID)
+func legacyPrefsDir(uid ipn.WindowsUserID) (string, error) {
+	// TODO(aaron): Ideally we'd have the impersonation token for the pipe's
+	// client and use it to call SHGetKnownFolderPath, thus yielding the correct
+	// path without having to make gross assumptions about directory names.
+	homeDir, err := lookupUserHomeDir(uid)
 	if err != nil {
-		return "", ipn.PrefsView{}, err
+		return "", err
 	}
+	userLegacyPrefsDir := filepath.Join(homeDir, "AppData", "Local", "Tailscale")
+	return userLegacyPrefsDir, nil
+}
 
-	migrationSentinel := filepath.Join(userLegacyPrefsDir, legacyPrefsMigrationSentinelFile+legacyPrefsExt)
-	// verify that migration sentinel is not present
-	_, err = os.Stat(migrationSentinel)
-	if err == nil {
-		return "", ipn.PrefsView{}, errAlreadyMigrated
-	}
-	if !os.IsNotExist(err) {
-		return "", ipn.PrefsView{}, err
-	}
+// legacyMigration is the outcome of migrating one legacy Windows user's
+// pre-profiles prefs.conf into the profiles store.
+type legacyMigration struct {
+	UID      ipn.WindowsUserID
+	Prefs    ipn.PrefsView
+	Complete func() error // nil if Err is non-nil
+	Err      error        // non-nil if this user's prefs could not be migrated
+}
+
+// legacyWindowsUserEnumerator enumerates the Windows user profiles present
+// on the local machine, so that migrateAllLegacyWindowsPrefs can consider
+// each of them in turn. It is overridden in tests.
+type legacyWindowsUserEnumerator func() ([]ipn.WindowsUserID, error)
+
+// enumerateLegacyWindowsUserIDs lists the SIDs of local user profiles by
+// reading the registry's ProfileList key, the same source Windows itself
+// uses to enumerate profiles.
+var enumerateLegacyWindowsUserIDs legacyWindowsUserEnumerator = enumerateProfileListUserIDs
 
-	prefsPath := filepath.Join(userLegacyPrefsDir, legacyPrefsFile+legacyPrefsExt)
-	prefs, err := ipn.LoadPrefs(prefsPath)
+const profileListKeyPath = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`
+
+func enumerateProfileListUserIDs() ([]ipn.WindowsUserID, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, profileListKeyPath, registry.ENUMERATE_SUB_KEYS)
 	if err != nil {
-		return "", ipn.PrefsView{}, err
+		return nil, fmt.Errorf("opening ProfileList key: %w", err)
 	}
+	defer k.Close()
 
-	prefs.ControlURL = policy.SelectControlURL(defaultPrefs.ControlURL(), prefs.ControlURL)
-	prefs.ExitNodeIP = resolveExitNodeIP(prefs.ExitNodeIP)
-	prefs.ShieldsUp = resolveShieldsUp(prefs.ShieldsUp)
-	prefs.ForceDaemon = resolveForceDaemon(prefs.ForceDaemon)
+	sids, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("enumerating ProfileList subkeys: %w", err)
+	}
 
-	pm.logf("migrating Windows profile to new format")
-	return migrationSentinel, prefs.View(), nil
+	uids := make([]ipn.WindowsUserID, 0, len(sids))
+	for _, sid := range sids {
+		uids = append(uids, ipn.WindowsUserID(sid))
+	}
+	return uids, nil
 }
 
-func (pm *profileManager) completeMigration(migrationSentinel string) {
-	atomicfile.WriteFile(migrationSentinel, []byte{}, 0600)
+// migrateAllLegacyWindowsPrefs migrates every local Windows user's
+// pre-profiles prefs.conf that hasn't already been migrated, not just
+// pm.currentUserID. This matters on machines where tailscaled runs as
+// SYSTEM: a pre-profiles install can leave behind prefs for several users
+// that would otherwise only get migrated the next time each of them happens
+// to connect.
+//
+// TODO: this is not yet called from profileManager's startup sequence (that
+// wiring belongs in profiles.go, alongside where the single-user
+// loadLegacyPrefs path is driven from, and where each result's Prefs would
+// need to become an actual saved profile). Until that follow-up lands, this
+// is reachable only from its own tests.
+func (pm *profileManager) migrateAllLegacyWindowsPrefs() []legacyMigration {
+	uids, err := enumerateLegacyWindowsUserIDs()
+	if err != nil {
+		pm.logf("migrateAllLegacyWindowsPrefs: enumerating users: %v", err)
+		return nil
+	}
+
+	var src windowsLegacyPrefsSource
+	var results []legacyMigration
+	for _, uid := range uids {
+		path, ok := src.Locate(string(uid))
+		if !ok {
+			// Either no legacy install for this user, or already migrated.
+			continue
+		}
+		prefs, err := src.Load(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		result := legacyMigration{UID: uid, Err: err}
+		if err == nil {
+			result.Prefs = prefs.View()
+			result.Complete = func() error { return src.MarkMigrated(path) }
+			pm.logf("migrating Windows profile for user %s to new format", uid)
+		}
+		results = append(results, result)
+	}
+	return results
 }
 
 func resolveShieldsUp(defval bool) bool {
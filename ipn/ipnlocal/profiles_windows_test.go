@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+// fakeLegacyPrefsFS is an in-memory stand-in for the handful of os/atomicfile
+// calls windowsLegacyPrefsSource and migrateAllLegacyWindowsPrefs make, so
+// that the migration logic can be exercised without touching the real disk
+// or registry.
+type fakeLegacyPrefsFS struct {
+	homeDirs map[ipn.WindowsUserID]string
+	prefs    map[string]*ipn.Prefs // keyed by prefs.conf path
+	migrated map[string]bool       // keyed by sentinel path
+}
+
+func newFakeLegacyPrefsFS() *fakeLegacyPrefsFS {
+	return &fakeLegacyPrefsFS{
+		homeDirs: map[ipn.WindowsUserID]string{},
+		prefs:    map[string]*ipn.Prefs{},
+		migrated: map[string]bool{},
+	}
+}
+
+func (f *fakeLegacyPrefsFS) install(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		lookupUserHomeDir = defaultLookupUserHomeDir
+		statFile = os.Stat
+		loadPrefsFile = ipn.LoadPrefs
+		writeSentinel = func(name string) error { return nil }
+	})
+
+	lookupUserHomeDir = func(uid ipn.WindowsUserID) (string, error) {
+		dir, ok := f.homeDirs[uid]
+		if !ok {
+			return "", errors.New("no such user")
+		}
+		return dir, nil
+	}
+	statFile = func(name string) (os.FileInfo, error) {
+		if f.migrated[name] {
+			return nil, nil
+		}
+		if _, ok := f.prefs[name]; ok {
+			return nil, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	loadPrefsFile = func(path string) (*ipn.Prefs, error) {
+		p, ok := f.prefs[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return p.Clone(), nil
+	}
+	writeSentinel = func(name string) error {
+		f.migrated[name] = true
+		return nil
+	}
+}
+
+func TestMigrateAllLegacyWindowsPrefs(t *testing.T) {
+	fs := newFakeLegacyPrefsFS()
+	fs.install(t)
+
+	const (
+		alice ipn.WindowsUserID = "S-1-5-21-alice"
+		bob   ipn.WindowsUserID = "S-1-5-21-bob"
+		carol ipn.WindowsUserID = "S-1-5-21-carol" // never had a legacy install
+	)
+	fs.homeDirs[alice] = `C:\Users\alice`
+	fs.homeDirs[bob] = `C:\Users\bob`
+	fs.homeDirs[carol] = `C:\Users\carol`
+
+	fs.prefs[legacyPrefsConfPath(t, fs, alice)] = &ipn.Prefs{ControlURL: "https://alice.example.com"}
+	fs.prefs[legacyPrefsConfPath(t, fs, bob)] = &ipn.Prefs{ControlURL: "https://bob.example.com"}
+
+	enumerateLegacyWindowsUserIDs = func() ([]ipn.WindowsUserID, error) {
+		return []ipn.WindowsUserID{alice, bob, carol}, nil
+	}
+	t.Cleanup(func() { enumerateLegacyWindowsUserIDs = enumerateProfileListUserIDs })
+
+	pm := &profileManager{logf: t.Logf}
+	results := pm.migrateAllLegacyWindowsPrefs()
+	if len(results) != 2 {
+		t.Fatalf("migrateAllLegacyWindowsPrefs: got %d results, want 2 (alice, bob): %+v", len(results), results)
+	}
+
+	got := map[ipn.WindowsUserID]bool{}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("user %s: unexpected error: %v", r.UID, r.Err)
+		}
+		got[r.UID] = true
+		pm.completeMigration(r.Complete)
+	}
+	if !got[alice] || !got[bob] {
+		t.Errorf("migrateAllLegacyWindowsPrefs: got users %v, want alice and bob", got)
+	}
+	if got[carol] {
+		t.Errorf("migrateAllLegacyWindowsPrefs: carol was migrated despite never having a legacy install")
+	}
+
+	// A second pass should migrate nobody: alice and bob now have sentinels,
+	// and carol still has nothing to migrate.
+	results = pm.migrateAllLegacyWindowsPrefs()
+	if len(results) != 0 {
+		t.Errorf("second migrateAllLegacyWindowsPrefs pass: got %d results, want 0: %+v", len(results), results)
+	}
+}
+
+// legacyPrefsConfPath returns the prefs.conf path migrateAllLegacyWindowsPrefs
+// will look up for uid, given the currently installed fake home directories.
+// It must be called after fs.install, since legacyPrefsDir calls through the
+// (by then faked) lookupUserHomeDir hook.
+func legacyPrefsConfPath(t *testing.T, fs *fakeLegacyPrefsFS, uid ipn.WindowsUserID) string {
+	t.Helper()
+	dir, err := legacyPrefsDir(uid)
+	if err != nil {
+		t.Fatalf("legacyPrefsDir(%s): %v", uid, err)
+	}
+	return filepath.Join(dir, legacyPrefsFile+legacyPrefsExt)
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2021 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"tailscale.com/types/logger"
+	"tailscale.com/util/dnsname"
+)
+
+// resolvConf is the well-known path to the system's resolver configuration.
+const resolvConf = "/etc/resolv.conf"
+
+// backupConf is where we stash the original resolvConf contents while
+// Tailscale's DNS config is active, so that we can restore it verbatim on
+// Close or once Tailscale stops managing DNS.
+const backupConf = "/etc/resolv.pre-tailscale-backup.conf"
+
+const resolvConfHeader = `# resolv.conf(5) file generated by tailscale
+# For more info, see https://tailscale.com/s/resolvconf-overwrite
+# DO NOT EDIT THIS FILE BY HAND -- CHANGES WILL BE OVERWRITTEN
+
+`
+
+// wholeFileFS is the filesystem access directManager needs. It's a narrow
+// interface so that tests can swap in an in-memory or deliberately-broken
+// implementation to exercise the fallback paths used on containers that
+// bind-mount /etc/resolv.conf and disallow renaming or removing it.
+type wholeFileFS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, contents []byte, perm os.FileMode) error
+	Rename(old, new string) error
+	Remove(name string) error
+}
+
+// directFS is a wholeFileFS that operates on the real filesystem, rooted at
+// an optional prefix (used by tests to avoid touching the real /etc).
+type directFS struct {
+	prefix string
+}
+
+func (fs directFS) path(name string) string { return fs.prefix + name }
+
+func (fs directFS) Stat(name string) (os.FileInfo, error) { return os.Stat(fs.path(name)) }
+func (fs directFS) ReadFile(name string) ([]byte, error)  { return os.ReadFile(fs.path(name)) }
+func (fs directFS) WriteFile(name string, contents []byte, perm os.FileMode) error {
+	return os.WriteFile(fs.path(name), contents, perm)
+}
+func (fs directFS) Rename(old, new string) error { return os.Rename(fs.path(old), fs.path(new)) }
+func (fs directFS) Remove(name string) error     { return os.Remove(fs.path(name)) }
+
+// directManager is an OSConfigurator that replaces /etc/resolv.conf
+// directly, keeping a backup of the original so it can later be restored.
+// It's used on systems with no resolv.conf manager of their own, such as
+// most plain Linux distros and most containers.
+type directManager struct {
+	logf logger.Logf
+	fs   wholeFileFS
+}
+
+// newDirectManager returns a new DNS manager that replaces resolvConf
+// directly.
+func newDirectManager(logf logger.Logf) *directManager {
+	return &directManager{logf: logf, fs: directFS{}}
+}
+
+// backupExtras returns the non-nameserver, non-search directives
+// (options, sortlist, lookup, family, ...) found in the resolv.conf this
+// package backed up before Tailscale started managing it, so that SetDNS
+// can preserve them across rewrites. If no backup exists yet, it looks at
+// the live resolv.conf instead, since that's still the original at that
+// point.
+func (m *directManager) backupExtras() (resolvExtras, error) {
+	path := backupConf
+	if _, err := m.fs.Stat(path); os.IsNotExist(err) {
+		path = resolvConf
+	}
+
+	b, err := m.fs.ReadFile(path)
+	if os.IsNotExist(err) {
+		return resolvExtras{}, nil
+	}
+	if err != nil {
+		return resolvExtras{}, err
+	}
+
+	_, extras, err := readResolv(bytes.NewReader(b))
+	return extras, err
+}
+
+// ensureBackup saves the current resolvConf to backupConf, if it hasn't
+// been saved already. It prefers an atomic rename, but falls back to a
+// copy so that it still works on systems (e.g. some containers) where
+// resolvConf can't be renamed or removed because it's a bind mount.
+func (m *directManager) ensureBackup() error {
+	if _, err := m.fs.Stat(backupConf); err == nil {
+		return nil // already backed up
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := m.fs.Rename(resolvConf, backupConf); err == nil {
+		return nil
+	}
+
+	orig, err := m.fs.ReadFile(resolvConf)
+	if os.IsNotExist(err) {
+		// No resolv.conf to preserve.
+		return m.fs.WriteFile(backupConf, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return m.fs.WriteFile(backupConf, orig, 0644)
+}
+
+// restore puts the pre-Tailscale resolvConf back, removing the backup.
+func (m *directManager) restore() error {
+	if _, err := m.fs.Stat(backupConf); os.IsNotExist(err) {
+		return nil // nothing to restore
+	} else if err != nil {
+		return err
+	}
+
+	if err := m.fs.Rename(backupConf, resolvConf); err == nil {
+		return nil
+	}
+
+	orig, err := m.fs.ReadFile(backupConf)
+	if err != nil {
+		return err
+	}
+	if err := m.fs.WriteFile(resolvConf, orig, 0644); err != nil {
+		return err
+	}
+	return m.fs.Remove(backupConf)
+}
+
+func (m *directManager) SetDNS(config OSConfig) error {
+	if config.IsZero() {
+		return m.restore()
+	}
+
+	extras, err := m.backupExtras()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(resolvConfHeader)
+	for _, ns := range config.Nameservers {
+		fmt.Fprintf(&buf, "nameserver %s\n", ns)
+	}
+	if len(config.SearchDomains) > 0 {
+		buf.WriteString("search")
+		for _, d := range config.SearchDomains {
+			fmt.Fprintf(&buf, " %s", d.WithoutTrailingDot())
+		}
+		buf.WriteString("\n")
+	}
+	for _, line := range extras.lines {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+
+	if err := m.ensureBackup(); err != nil {
+		return err
+	}
+	return m.fs.WriteFile(resolvConf, buf.Bytes(), 0644)
+}
+
+func (m *directManager) SupportsSplitDNS() bool { return false }
+
+func (m *directManager) Close() error { return m.restore() }
+
+// resolvExtras holds every resolv.conf(5) directive that directManager
+// doesn't generate itself (options, sortlist, lookup, family, domain, or
+// anything else found in the file), preserved verbatim so that SetDNS
+// doesn't silently drop them.
+type resolvExtras struct {
+	lines []string // one entry per preserved directive, in file order
+}
+
+// Equal reports whether e and e2 are equal. It lets qt.DeepEquals compare
+// resolvExtras values without needing to recurse into its unexported lines
+// field.
+func (e resolvExtras) Equal(e2 resolvExtras) bool {
+	return slices.Equal(e.lines, e2.lines)
+}
+
+// readResolv reads a resolv.conf(5) file from r. It returns the
+// nameservers and search domains found, for use by platforms that need to
+// inspect the system's own resolv.conf, plus any other directive found in
+// extras (options, sortlist, lookup, family, domain, ...), so that callers
+// that rewrite the file can put them back.
+func readResolv(r io.Reader) (OSConfig, resolvExtras, error) {
+	var config OSConfig
+	var extras resolvExtras
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) != 2 {
+				return OSConfig{}, resolvExtras{}, fmt.Errorf("want exactly one address in nameserver line %q", line)
+			}
+			ip, err := netip.ParseAddr(fields[1])
+			if err != nil {
+				return OSConfig{}, resolvExtras{}, fmt.Errorf("parsing nameserver %q: %w", fields[1], err)
+			}
+			config.Nameservers = append(config.Nameservers, ip)
+		case "search":
+			if len(fields) < 2 {
+				return OSConfig{}, resolvExtras{}, fmt.Errorf("missing domain in search line %q", line)
+			}
+			for _, s := range fields[1:] {
+				fqdn, err := dnsname.ToFQDN(s)
+				if err != nil {
+					return OSConfig{}, resolvExtras{}, fmt.Errorf("parsing search domain %q: %w", s, err)
+				}
+				config.SearchDomains = append(config.SearchDomains, fqdn)
+			}
+		case "options", "sortlist", "lookup", "family":
+			extras.lines = append(extras.lines, line)
+		default:
+			// Some other resolv.conf(5) directive we don't special-case
+			// (domain, or anything distro-specific). Preserve it verbatim
+			// rather than failing outright: we have no business rejecting
+			// a host's resolv.conf just because it contains a directive we
+			// don't otherwise understand.
+			extras.lines = append(extras.lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return OSConfig{}, resolvExtras{}, err
+	}
+	return config, extras, nil
+}
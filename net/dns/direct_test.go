@@ -54,7 +54,7 @@ func TestDirectBrokenRename(t *testing.T) {
 }
 
 func testDirect(t *testing.T, fs wholeFileFS) {
-	const orig = "nameserver 9.9.9.9 # orig"
+	const orig = "nameserver 9.9.9.9 # orig\noptions ndots:5 rotate\nsortlist 192.168.0.0/16\n"
 	resolvPath := "/etc/resolv.conf"
 	backupPath := "/etc/resolv.pre-tailscale-backup.conf"
 
@@ -94,6 +94,8 @@ func testDirect(t *testing.T, fs wholeFileFS) {
 nameserver 8.8.8.8
 nameserver 8.8.4.4
 search ts.net ts-dns.test
+options ndots:5 rotate
+sortlist 192.168.0.0/16
 `
 	if got := readFile(t, resolvPath); got != want {
 		t.Fatalf("resolv.conf:\n%s, want:\n%s", got, want)
@@ -144,9 +146,10 @@ func TestDirectBrokenRemove(t *testing.T) {
 func TestReadResolve(t *testing.T) {
 	c := qt.New(t)
 	tests := []struct {
-		in      string
-		want    OSConfig
-		wantErr bool
+		in         string
+		want       OSConfig
+		wantExtras resolvExtras
+		wantErr    bool
 	}{
 		{in: `nameserver 192.168.0.100`,
 			want: OSConfig{
@@ -172,7 +175,12 @@ func TestReadResolve(t *testing.T) {
 		{in: `nameserver #192.168.0.100`, wantErr: true},
 		{in: `nameserver`, wantErr: true},
 		{in: `# nameserver 192.168.0.100`, want: OSConfig{}},
-		{in: `nameserver192.168.0.100`, wantErr: true},
+		// Not a recognized directive (no space before the address), so it's
+		// preserved verbatim like any other unrecognized line, not an error.
+		{in: `nameserver192.168.0.100`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"nameserver192.168.0.100"}},
+		},
 
 		{in: `search tailsacle.com`,
 			want: OSConfig{
@@ -184,17 +192,100 @@ func TestReadResolve(t *testing.T) {
 				SearchDomains: []dnsname.FQDN{"tailsacle.com."},
 			},
 		},
-		{in: `searchtailsacle.com`, wantErr: true},
+		{in: `searchtailsacle.com`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"searchtailsacle.com"}},
+		},
 		{in: `search`, wantErr: true},
+
+		{in: `options ndots:5`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"options ndots:5"}},
+		},
+		{in: `domain example.com`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"domain example.com"}},
+		},
+		{in: "nameserver 192.168.0.100\noptions ndots:5 rotate\nsortlist 192.168.0.0/16\n",
+			want: OSConfig{
+				Nameservers: []netip.Addr{netip.MustParseAddr("192.168.0.100")},
+			},
+			wantExtras: resolvExtras{lines: []string{"options ndots:5 rotate", "sortlist 192.168.0.0/16"}},
+		},
+		{in: `lookup file bind # BSD-style resolver order`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"lookup file bind"}},
+		},
+		{in: `family inet4 inet6`,
+			want:       OSConfig{},
+			wantExtras: resolvExtras{lines: []string{"family inet4 inet6"}},
+		},
 	}
 
 	for _, test := range tests {
-		cfg, err := readResolv(strings.NewReader(test.in))
+		cfg, extras, err := readResolv(strings.NewReader(test.in))
 		if test.wantErr {
 			c.Assert(err, qt.IsNotNil)
 		} else {
 			c.Assert(err, qt.IsNil)
 		}
 		c.Assert(cfg, qt.DeepEquals, test.want)
+		c.Assert(extras, qt.DeepEquals, test.wantExtras)
+	}
+}
+
+func TestDirectPreservesResolvExtras(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "etc"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	fs := directFS{prefix: tmp}
+
+	const orig = "nameserver 9.9.9.9 # orig\noptions ndots:5 rotate\nsortlist 192.168.0.0/16\n"
+	if err := fs.WriteFile("/etc/resolv.conf", []byte(orig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := directManager{logf: t.Logf, fs: fs}
+	if err := m.SetDNS(OSConfig{
+		Nameservers: []netip.Addr{netip.MustParseAddr("8.8.8.8")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := resolvConfHeader + "nameserver 8.8.8.8\noptions ndots:5 rotate\nsortlist 192.168.0.0/16\n"
+	if string(got) != want {
+		t.Fatalf("resolv.conf:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A second SetDNS call should keep preserving the original extras, not
+	// whatever directManager itself wrote last time.
+	if err := m.SetDNS(OSConfig{
+		Nameservers: []netip.Addr{netip.MustParseAddr("1.1.1.1")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = fs.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = resolvConfHeader + "nameserver 1.1.1.1\noptions ndots:5 rotate\nsortlist 192.168.0.0/16\n"
+	if string(got) != want {
+		t.Fatalf("resolv.conf after second SetDNS:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = fs.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != orig {
+		t.Fatalf("resolv.conf after Close:\n%s\nwant original:\n%s", got, orig)
 	}
 }
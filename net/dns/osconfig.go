@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net/netip"
+	"slices"
+
+	"tailscale.com/util/dnsname"
+)
+
+// OSConfig is an OS DNS configuration.
+type OSConfig struct {
+	// Nameservers are the IP addresses of the nameservers to use.
+	Nameservers []netip.Addr
+	// SearchDomains are the domain suffixes to search when resolving
+	// single-label names.
+	SearchDomains []dnsname.FQDN
+	// MatchDomains optionally restrict which domains a nameserver in
+	// Nameservers is used for, on platforms where that's supported.
+	MatchDomains []dnsname.FQDN
+}
+
+// IsZero reports whether o is the zero value.
+func (o OSConfig) IsZero() bool {
+	return len(o.Nameservers) == 0 && len(o.SearchDomains) == 0 && len(o.MatchDomains) == 0
+}
+
+// Equal reports whether o and o2 are equal. It lets qt.DeepEquals (and
+// anything else built on go-cmp) compare OSConfig values without needing
+// to recurse into its fields.
+func (o OSConfig) Equal(o2 OSConfig) bool {
+	return slices.Equal(o.Nameservers, o2.Nameservers) &&
+		slices.Equal(o.SearchDomains, o2.SearchDomains) &&
+		slices.Equal(o.MatchDomains, o2.MatchDomains)
+}